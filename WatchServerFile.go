@@ -4,6 +4,9 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/fsnotify.v1"
 )
@@ -15,17 +18,75 @@ type ReloadHandlerFunc func(watch *Server)
 // Server is the stuct that is composed of the http.Server. It also
 // holds the reload function and the channels that are used for signalling.
 type Server struct {
-	ReloadFile chan string
+	// ReloadFile delivers a ReloadEvent whenever the watcher decides a
+	// reload is warranted, coalescing bursts of filesystem events (see
+	// NewMulti/NewGlob) into a single send.
+	ReloadFile chan ReloadEvent
+
+	// ReloadErrors receives an error whenever a ReloadHandlerFunc fails to
+	// produce a usable handler (see RouterReloader). It is buffered so a
+	// reload never blocks on a reader being present.
+	ReloadErrors chan error
+
+	// BeforeReload, if set, is called before a reload is applied. Returning
+	// an error aborts the reload and keeps the previously installed handler.
+	BeforeReload func(ws *Server) error
+
+	// AfterReload, if set, is called once a reload has been applied
+	// successfully.
+	AfterReload func(ws *Server)
+
+	// HammerTime bounds how long Shutdown (and the drain that a
+	// SIGHUP/SIGUSR2 graceful restart triggers) waits for in-flight
+	// connections before forcing the old process closed. Zero means
+	// DefaultHammerTime.
+	HammerTime time.Duration
+
+	reloadFunc ReloadHandlerFunc
+	handler    atomic.Value // holds http.Handler
+	listener   net.Listener
+
+	// challengeListener is the autocert HTTP-01 challenge listener set by
+	// ListenAndServeAutocert, if any. forkChild hands its FD down to a
+	// restarted child alongside listener so the challenge port doesn't
+	// race the child to rebind.
+	challengeListener net.Listener
+
+	// watcher is the fsnotify.Watcher created by New/NewMulti/NewGlob.
+	// watchCertFiles (see tls.go) adds the certificate/key files to this
+	// same watcher instead of starting a second one.
+	watcher       *fsnotify.Watcher
+	watcherMu     sync.Mutex
+	certCallbacks map[string]func()
 
-	reloadFunc  ReloadHandlerFunc
-	reloadServe chan struct{}
 	http.Server
 }
 
 // Handler is the function that is used to set the http.Server handler
-// when it needs to be reset
+// when it needs to be reset. It swaps the handler atomically so that
+// in-flight requests being served off the existing net.Listener keep
+// being routed to a valid handler during a reload.
 func (ws *Server) Handler(handler http.Handler) {
-	ws.Server.Handler = handler
+	if handler == nil {
+		handler = http.NotFoundHandler()
+	}
+	ws.handler.Store(handler)
+}
+
+// currentHandler returns the handler installed by the most recent reload.
+func (ws *Server) currentHandler() http.Handler {
+	h, _ := ws.handler.Load().(http.Handler)
+	if h == nil {
+		return http.NotFoundHandler()
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler by dispatching to whatever handler
+// was most recently installed via Handler, so reloads never require the
+// net.Listener to be closed and re-bound.
+func (ws *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws.currentHandler().ServeHTTP(w, r)
 }
 
 // ListenAndServe is the main function that is called. The main difference is
@@ -35,82 +96,63 @@ func (ws *Server) Handler(handler http.Handler) {
 func (ws *Server) ListenAndServe(address string, reloadFunc ReloadHandlerFunc) error {
 	ws.Addr = address
 	ws.reloadFunc = reloadFunc
+	ws.Server.Handler = ws
+
+	go ws.watchSignals()
 
 	// now wait for the other times when we needed to
 	go func() {
-		for {
-			// clear the handler
-			ws.Handler(nil)
-			ws.reloadFunc(ws)
-			ws.reloadServe <- struct{}{} // reset the listening binding
+		for range ws.ReloadFile {
+			ws.runReload()
 		}
 	}()
 
-	ws.reloadFunc(ws)
+	ws.runReload()
 	return ws.listenAndServe()
 }
 
-// listenAndServe is the function that would be most like a Mux
-// listen and serve function. It has a channel that does the blocking
-// and not the underlining Serve() function. This is so that the channel
-// can be unblocked to reset the handlers for the Serve() then then
-// the connection can be re-established.
+// runReload applies BeforeReload/reloadFunc/AfterReload for a single reload
+// cycle. The previously installed handler keeps serving traffic until
+// reloadFunc calls ws.Handler with the replacement.
+func (ws *Server) runReload() {
+	if ws.BeforeReload != nil {
+		if err := ws.BeforeReload(ws); err != nil {
+			log.Println("BeforeReload:", err)
+			return
+		}
+	}
+	ws.reloadFunc(ws)
+	if ws.AfterReload != nil {
+		ws.AfterReload(ws)
+	}
+}
+
+// listenAndServe binds (or inherits, see forkChild) the net.Listener once
+// and keeps it open for the lifetime of the process. Reloads only ever
+// swap the handler atomically, so they never drop in-flight connections
+// or race with Serve.
 func (ws *Server) listenAndServe() error {
 	addr := ws.Addr
 	if addr == "" {
 		addr = ":http"
 	}
-	ln, err := net.Listen("tcp", addr)
+
+	ln, err := inheritedListener()
 	if err != nil {
 		return err
 	}
-	for {
-		l := ln.(*net.TCPListener)
-		defer l.Close()
-		go func(l net.Listener) {
-			log.Println("Listening and serving", addr, "...")
-			ws.Serve(l)
-		}(l)
-		<-ws.reloadServe
-	}
-}
-
-// watchFile is the internal function that will grab the notifiy events
-// and then pass along the reloading of the file.
-func (ws *Server) watchFile(watcher *fsnotify.Watcher) {
-	for {
-		select {
-		case event := <-watcher.Events:
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				log.Println("Reloading the file...")
-				ws.ReloadFile <- event.Name
-			}
-		case err := <-watcher.Errors:
-			log.Println("Watcher Error:", err)
+	if ln == nil {
+		ln, err = net.Listen("tcp", addr)
+		if err != nil {
+			return err
 		}
 	}
-}
-
-// New accepts a list of file names that can be watch, it will
-// then return a new object that can be used kinda like the
-// http.Server object.
-func New(filename string) *Server {
-	ws := new(Server)
-	ws.ReloadFile = make(chan string, 1)
-	ws.reloadServe = make(chan struct{}, 1)
+	ws.listener = ln
 
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal("Watcher: ", err)
-	}
-
-	err = watcher.Add(filename)
-	if err != nil {
-		log.Fatal("New WatcherServer: ", err)
+	log.Println("Listening and serving", addr, "...")
+	err = ws.Serve(ln)
+	if err == http.ErrServerClosed {
+		return nil
 	}
-
-	ws.ReloadFile <- filename
-	go ws.watchFile(watcher)
-
-	return ws
+	return err
 }
@@ -0,0 +1,168 @@
+package watchserverfile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// inheritedFDEnv is the environment variable a forked child reads to find
+// the file descriptor of the primary listener handed down by its parent.
+const inheritedFDEnv = "WATCHSERVERFILE_FD"
+
+// inheritedChallengeFDEnv is the environment variable a forked child reads
+// to find the file descriptor of the autocert HTTP-01 challenge listener
+// (see ListenAndServeAutocert), handed down alongside the primary listener
+// on WATCHSERVERFILE_FD.
+const inheritedChallengeFDEnv = "WATCHSERVERFILE_CHALLENGE_FD"
+
+// DefaultHammerTime is the drain bound used by a Server whose HammerTime
+// is zero (or negative).
+const DefaultHammerTime = 60 * time.Second
+
+// hammerTime returns ws.HammerTime, falling back to DefaultHammerTime when
+// ws.HammerTime is not positive.
+func (ws *Server) hammerTime() time.Duration {
+	if ws.HammerTime <= 0 {
+		return DefaultHammerTime
+	}
+	return ws.HammerTime
+}
+
+// Shutdown drains in-flight connections on ws's listener and returns once
+// they have finished or ctx is done, whichever comes first. If ctx has no
+// deadline, ws.HammerTime is used to bound the wait.
+func (ws *Server) Shutdown(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.hammerTime())
+		defer cancel()
+	}
+	return ws.Server.Shutdown(ctx)
+}
+
+// watchSignals listens for SIGHUP and SIGUSR2, the conventional signals
+// used by endless/gracehttp to request a graceful restart, and forks a
+// replacement process that inherits the listening socket(s). extra lists
+// any other Servers (e.g. a Mux's sub-protocol servers, see
+// ListenAndServeMux) that must drain alongside ws before this process
+// exits; ws itself is always drained.
+func (ws *Server) watchSignals(extra ...*Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGUSR2)
+	for range sig {
+		log.Println("Received restart signal, forking child...")
+		if err := ws.forkChild(); err != nil {
+			log.Println("forkChild:", err)
+			continue
+		}
+		log.Println("Forked child, draining old process...")
+
+		var wg sync.WaitGroup
+		for _, srv := range append([]*Server{ws}, extra...) {
+			wg.Add(1)
+			go func(srv *Server) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), srv.hammerTime())
+				defer cancel()
+				if err := srv.Shutdown(ctx); err != nil {
+					log.Println("Shutdown:", err)
+				}
+			}(srv)
+		}
+		wg.Wait()
+		os.Exit(0)
+	}
+}
+
+// forkChild execs a copy of the running binary, passing ws.listener's file
+// descriptor through WATCHSERVERFILE_FD so the child can pick up right
+// where this process leaves off via net.FileListener. If ws.challengeListener
+// is set (see ListenAndServeAutocert), its FD is handed down alongside it
+// through WATCHSERVERFILE_CHALLENGE_FD so the autocert HTTP-01 listener
+// survives the restart too instead of racing the child to rebind its addr.
+func (ws *Server) forkChild() error {
+	handoffs := []struct {
+		env string
+		ln  net.Listener
+	}{{inheritedFDEnv, ws.listener}}
+	if ws.challengeListener != nil {
+		handoffs = append(handoffs, struct {
+			env string
+			ln  net.Listener
+		}{inheritedChallengeFDEnv, ws.challengeListener})
+	}
+
+	var files []*os.File
+	env := os.Environ()
+	for i, h := range handoffs {
+		f, err := listenerFile(h.ln)
+		if err != nil {
+			return fmt.Errorf("%s: %v", h.env, err)
+		}
+		defer f.Close()
+		files = append(files, f)
+		env = append(env, fmt.Sprintf("%s=%d", h.env, 3+i))
+	}
+
+	execSpec, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	child := exec.Command(execSpec, os.Args[1:]...)
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	child.ExtraFiles = files
+	child.Env = env
+
+	return child.Start()
+}
+
+// listenerFile returns the *os.File backing ln, so it can be passed to a
+// forked child through exec.Cmd.ExtraFiles.
+func listenerFile(ln net.Listener) (*os.File, error) {
+	fdListener, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener does not support File(), cannot hand off FD")
+	}
+	return fdListener.File()
+}
+
+// inheritedListener returns the net.Listener described by WATCHSERVERFILE_FD,
+// or nil if this process was not started as the child of a graceful
+// restart.
+func inheritedListener() (net.Listener, error) {
+	return inheritedListenerNamed(inheritedFDEnv)
+}
+
+// inheritedListenerNamed returns the net.Listener described by the FD number
+// in envVar, or nil if envVar isn't set (this process wasn't handed a
+// listener under that name).
+func inheritedListenerNamed(envVar string) (net.Listener, error) {
+	fdStr := os.Getenv(envVar)
+	if fdStr == "" {
+		return nil, nil
+	}
+	os.Unsetenv(envVar)
+
+	var fd int
+	if _, err := fmt.Sscanf(fdStr, "%d", &fd); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", envVar, err)
+	}
+
+	f := os.NewFile(uintptr(fd), "inherited-listener")
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return ln, nil
+}
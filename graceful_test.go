@@ -0,0 +1,117 @@
+package watchserverfile
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHammerTimeFallsBackToDefault(t *testing.T) {
+	ws := &Server{}
+	if got := ws.hammerTime(); got != DefaultHammerTime {
+		t.Errorf("hammerTime() = %v, want DefaultHammerTime (%v)", got, DefaultHammerTime)
+	}
+}
+
+func TestHammerTimeUsesOverride(t *testing.T) {
+	ws := &Server{HammerTime: 5 * time.Second}
+	if got := ws.hammerTime(); got != 5*time.Second {
+		t.Errorf("hammerTime() = %v, want 5s", got)
+	}
+}
+
+func TestShutdownBoundsWaitByHammerTimeWhenCtxHasNoDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	block := make(chan struct{})
+	ws := &Server{HammerTime: 100 * time.Millisecond}
+	ws.Server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-block
+	})
+	defer close(block)
+
+	go ws.Server.Serve(ln)
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the in-flight handler to start")
+	}
+
+	begin := time.Now()
+	err = ws.Shutdown(context.Background())
+	elapsed := time.Since(begin)
+
+	if err == nil {
+		t.Fatal("Shutdown: expected an error from the blocked connection exceeding HammerTime, got nil")
+	}
+	if elapsed < ws.HammerTime {
+		t.Errorf("Shutdown returned after %v, want at least HammerTime (%v)", elapsed, ws.HammerTime)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Shutdown took %v, want roughly HammerTime (%v)", elapsed, ws.HammerTime)
+	}
+}
+
+func TestRunReloadSkipsReloadFuncWhenBeforeReloadErrors(t *testing.T) {
+	var reloaded, afterCalled bool
+	ws := &Server{
+		BeforeReload: func(ws *Server) error { return errors.New("validation failed") },
+		AfterReload:  func(ws *Server) { afterCalled = true },
+		reloadFunc:   func(ws *Server) { reloaded = true },
+	}
+
+	ws.runReload()
+
+	if reloaded {
+		t.Error("runReload: reloadFunc ran despite BeforeReload returning an error")
+	}
+	if afterCalled {
+		t.Error("runReload: AfterReload ran despite BeforeReload returning an error")
+	}
+}
+
+func TestRunReloadCallsAfterReloadOnSuccess(t *testing.T) {
+	var order []string
+	ws := &Server{
+		BeforeReload: func(ws *Server) error {
+			order = append(order, "before")
+			return nil
+		},
+		reloadFunc: func(ws *Server) {
+			order = append(order, "reload")
+		},
+		AfterReload: func(ws *Server) {
+			order = append(order, "after")
+		},
+	}
+
+	ws.runReload()
+
+	want := []string{"before", "reload", "after"}
+	if len(order) != len(want) {
+		t.Fatalf("runReload order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("runReload order = %v, want %v", order, want)
+		}
+	}
+}
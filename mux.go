@@ -0,0 +1,277 @@
+package watchserverfile
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+)
+
+// MatchFunc inspects the first bytes read off a new connection and reports
+// whether that connection belongs to the protocol it matches. It must not
+// consume data permanently: Mux peeks the bytes and restores them for
+// whichever sub-listener ends up accepting the connection.
+type MatchFunc func(data []byte) bool
+
+// HTTPMatcher matches the beginning of an HTTP/1.x request line, e.g.
+// "GET ", "POST", "HEAD", "PUT ".
+func HTTPMatcher(data []byte) bool {
+	for _, method := range [][]byte{
+		[]byte("GET "), []byte("POST"), []byte("HEAD"), []byte("PUT "),
+		[]byte("DELE"), []byte("CONN"), []byte("OPTI"), []byte("TRAC"), []byte("PATC"),
+	} {
+		if len(data) >= len(method) && string(data[:len(method)]) == string(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSMatcher matches the leading record-type byte of a TLS handshake
+// (0x16 is the ContentType for a Handshake record).
+func TLSMatcher(data []byte) bool {
+	return len(data) > 0 && data[0] == 0x16
+}
+
+// sniffLen is the number of bytes peeked off a connection before it is
+// handed to MatchFuncs. It is generous enough to cover the longest HTTP
+// method name and the whole TLS record header.
+const sniffLen = 8
+
+// Mux wraps a net.Listener and dispatches each accepted connection to the
+// first registered sub-listener whose MatchFuncs accept it. It is modeled
+// on fatedier/golib's mux package.
+type Mux struct {
+	root net.Listener
+
+	mu      sync.Mutex
+	matches []*muxListener
+	def     *muxListener
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewMux returns a Mux that accepts connections from root. Call Serve to
+// start dispatching.
+func NewMux(root net.Listener) *Mux {
+	return &Mux{
+		root:   root,
+		closed: make(chan struct{}),
+	}
+}
+
+// Match registers a sub-listener for connections whose first bytes satisfy
+// every one of matchers. The returned net.Listener yields the original,
+// unconsumed connection to its Accept caller.
+func (m *Mux) Match(matchers ...MatchFunc) net.Listener {
+	ml := &muxListener{
+		mux:   m,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	m.mu.Lock()
+	ml.matches = matchers
+	m.matches = append(m.matches, ml)
+	m.mu.Unlock()
+	return ml
+}
+
+// Default registers the sub-listener that receives connections matched by
+// none of the MatchFuncs registered via Match.
+func (m *Mux) Default() net.Listener {
+	ml := &muxListener{
+		mux:   m,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.def = ml
+	m.mu.Unlock()
+	return ml
+}
+
+// Serve accepts connections from the root listener and dispatches each one
+// to the first matching sub-listener. It blocks until the root listener is
+// closed, so it is normally run in its own goroutine.
+func (m *Mux) Serve() error {
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			m.closeOnce.Do(func() { close(m.closed) })
+			return err
+		}
+		go m.dispatch(conn)
+	}
+}
+
+func (m *Mux) dispatch(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	peeked, err := br.Peek(sniffLen)
+	if err != nil && len(peeked) == 0 {
+		conn.Close()
+		return
+	}
+
+	pc := &peekedConn{Conn: conn, r: br}
+
+	m.mu.Lock()
+	matches := m.matches
+	def := m.def
+	m.mu.Unlock()
+
+	for _, ml := range matches {
+		if ml.match(peeked) {
+			ml.deliver(pc)
+			return
+		}
+	}
+	if def != nil {
+		def.deliver(pc)
+		return
+	}
+	conn.Close()
+}
+
+// peekedConn is a net.Conn whose initial bytes were peeked by bufio.Reader
+// for protocol sniffing; reads are served from that buffer first so the
+// sniffed bytes are not lost to whichever handler ends up owning the conn.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// muxListener is the net.Listener returned by Mux.Match/Mux.Default.
+type muxListener struct {
+	mux     *Mux
+	matches []MatchFunc
+	conns   chan net.Conn
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (ml *muxListener) match(peeked []byte) bool {
+	for _, fn := range ml.matches {
+		if !fn(peeked) {
+			return false
+		}
+	}
+	return len(ml.matches) > 0
+}
+
+func (ml *muxListener) deliver(conn net.Conn) {
+	select {
+	case ml.conns <- conn:
+	case <-ml.done:
+		conn.Close()
+	case <-ml.mux.closed:
+		conn.Close()
+	}
+}
+
+func (ml *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ml.conns:
+		return conn, nil
+	case <-ml.done:
+		return nil, errors.New("watchserverfile: mux listener closed")
+	case <-ml.mux.closed:
+		return nil, errors.New("watchserverfile: mux closed")
+	}
+}
+
+// Close stops this sub-listener from delivering any further connections.
+// Connections already dispatched to it but not yet Accept-ed are dropped.
+// Other sub-listeners on the same Mux are unaffected.
+func (ml *muxListener) Close() error {
+	ml.closeOnce.Do(func() { close(ml.done) })
+	return nil
+}
+
+func (ml *muxListener) Addr() net.Addr {
+	return ml.mux.root.Addr()
+}
+
+// MuxProtocol pairs a set of MatchFuncs with the Server that should serve
+// the connections they match. Passing a MuxProtocol to ListenAndServeMux
+// ties that protocol's reloads to the same reload cycle as the primary
+// HTTP handler, so a reload of the watched file swaps every protocol's
+// handler atomically rather than leaving the extra protocols stuck on
+// whatever they were first configured with.
+type MuxProtocol struct {
+	Match      []MatchFunc
+	Server     *Server
+	ReloadFunc ReloadHandlerFunc
+}
+
+// ListenAndServeMux binds (or inherits, see forkChild) address and puts a
+// Mux in front of it, so the file being watched can drive more than one
+// protocol off a single port: ws itself serves the HTTP sub-listener, and
+// each entry in protocols serves the sub-listener matched by its own
+// MatchFuncs (e.g. TLSMatcher for a TLS-terminated handler). Every reload
+// delivered on ws.ReloadFile runs ws's reloadFunc and then every
+// protocol's ReloadFunc before the tick is considered complete, so all
+// sub-protocols reload atomically together. A SIGHUP/SIGUSR2 graceful
+// restart hands off the root listener the same way ListenAndServe does,
+// and drains ws and every protocol's Server before this process exits.
+func (ws *Server) ListenAndServeMux(address string, reloadFunc ReloadHandlerFunc, protocols ...*MuxProtocol) (*Mux, error) {
+	ws.Addr = address
+	ws.reloadFunc = reloadFunc
+	ws.Server.Handler = ws
+
+	addr := ws.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	root, err := inheritedListener()
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		root, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ws.listener = root
+
+	mux := NewMux(root)
+	httpLn := mux.Match(HTTPMatcher)
+
+	protoServers := make([]*Server, len(protocols))
+	for i, proto := range protocols {
+		proto.Server.listener = mux.Match(proto.Match...)
+		proto.Server.reloadFunc = proto.ReloadFunc
+		proto.Server.Server.Handler = proto.Server
+		protoServers[i] = proto.Server
+	}
+
+	runAllReloads := func() {
+		ws.runReload()
+		for _, proto := range protocols {
+			proto.Server.runReload()
+		}
+	}
+
+	go ws.watchSignals(protoServers...)
+	go func() {
+		for range ws.ReloadFile {
+			runAllReloads()
+		}
+	}()
+	runAllReloads()
+
+	go mux.Serve()
+	go ws.Serve(httpLn)
+	for _, proto := range protocols {
+		go proto.Server.Serve(proto.Server.listener)
+	}
+
+	return mux, nil
+}
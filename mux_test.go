@@ -0,0 +1,168 @@
+package watchserverfile
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHTTPMatcher(t *testing.T) {
+	cases := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte("GET / HTTP/1.1\r\n"), true},
+		{[]byte("POST /x HTTP/1.1\r\n"), true},
+		{[]byte{0x16, 0x03, 0x01}, false},
+		{[]byte("XX"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := HTTPMatcher(c.data); got != c.want {
+			t.Errorf("HTTPMatcher(%q) = %v, want %v", c.data, got, c.want)
+		}
+	}
+}
+
+func TestTLSMatcher(t *testing.T) {
+	cases := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte{0x16, 0x03, 0x01}, true},
+		{[]byte("GET / HTTP/1.1\r\n"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := TLSMatcher(c.data); got != c.want {
+			t.Errorf("TLSMatcher(%q) = %v, want %v", c.data, got, c.want)
+		}
+	}
+}
+
+// dialAndWrite opens a connection to addr and writes data, leaving the
+// connection open so the server side can reply.
+func dialAndWrite(t *testing.T, addr string, data []byte) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return conn
+}
+
+func TestMuxDispatchesToMatchingSubListener(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer root.Close()
+
+	mux := NewMux(root)
+	httpLn := mux.Match(HTTPMatcher)
+	tlsLn := mux.Match(TLSMatcher)
+	defLn := mux.Default()
+
+	go mux.Serve()
+
+	conn := dialAndWrite(t, root.Addr().String(), []byte("GET / HTTP/1.0\r\n\r\n"))
+	defer conn.Close()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		c, err := httpLn.Accept()
+		accepted <- result{c, err}
+	}()
+
+	select {
+	case r := <-accepted:
+		if r.err != nil {
+			t.Fatalf("Accept: %v", r.err)
+		}
+		c := r.conn
+		defer c.Close()
+		line, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString: %v", err)
+		}
+		if want := "GET / HTTP/1.0\r\n"; line != want {
+			t.Errorf("peeked bytes not preserved: got %q, want %q", line, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for httpLn to accept the HTTP connection")
+	}
+
+	// tlsLn and defLn must not have received this connection.
+	select {
+	case <-accept(tlsLn):
+		t.Error("tlsLn unexpectedly accepted an HTTP connection")
+	case <-accept(defLn):
+		t.Error("defLn unexpectedly accepted an HTTP connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMuxDispatchesUnmatchedToDefault(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer root.Close()
+
+	mux := NewMux(root)
+	mux.Match(HTTPMatcher)
+	defLn := mux.Default()
+
+	go mux.Serve()
+
+	conn := dialAndWrite(t, root.Addr().String(), []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	defer conn.Close()
+
+	select {
+	case c := <-accept(defLn):
+		c.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for defLn to accept the unmatched connection")
+	}
+}
+
+func TestMuxListenerCloseStopsDelivery(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer root.Close()
+
+	mux := NewMux(root)
+	httpLn := mux.Match(HTTPMatcher)
+	httpLn.Close()
+
+	go mux.Serve()
+
+	conn := dialAndWrite(t, root.Addr().String(), []byte("GET / HTTP/1.0\r\n\r\n"))
+	defer conn.Close()
+
+	if _, err := httpLn.Accept(); err == nil {
+		t.Fatal("Accept: expected error from a closed muxListener, got nil")
+	}
+}
+
+// accept wraps ln.Accept in a channel so it can be used in a select.
+func accept(ln net.Listener) <-chan net.Conn {
+	ch := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			ch <- c
+		}
+	}()
+	return ch
+}
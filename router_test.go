@@ -0,0 +1,153 @@
+package watchserverfile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRouteTable(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRouterReloaderBuildValid(t *testing.T) {
+	path := writeRouteTable(t, t.TempDir(), "routes.json", `{
+		"routes": [
+			{"pattern": "/api/", "backend": "api"},
+			{"pattern": "/old", "redirect": "/new"}
+		]
+	}`)
+
+	rr := NewRouterReloader(path)
+	rr.Backends["api"] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler, err := rr.build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/", nil)
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /api/ = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/old", nil)
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Errorf("GET /old = %d, want %d", rec.Code, http.StatusFound)
+	}
+}
+
+func TestRouterReloaderBuildDuplicatePattern(t *testing.T) {
+	path := writeRouteTable(t, t.TempDir(), "routes.json", `{
+		"routes": [
+			{"pattern": "/api/", "static": "."},
+			{"pattern": "/api/", "static": "."}
+		]
+	}`)
+
+	rr := NewRouterReloader(path)
+	if _, err := rr.build(); err == nil {
+		t.Fatal("build: expected error for duplicate pattern, got nil")
+	}
+}
+
+func TestRouterReloaderBuildMissingPattern(t *testing.T) {
+	path := writeRouteTable(t, t.TempDir(), "routes.json", `{
+		"routes": [
+			{"static": "."}
+		]
+	}`)
+
+	rr := NewRouterReloader(path)
+	if _, err := rr.build(); err == nil {
+		t.Fatal("build: expected error for route with no pattern, got nil")
+	}
+}
+
+func TestRouterReloaderBuildUnknownBackend(t *testing.T) {
+	path := writeRouteTable(t, t.TempDir(), "routes.json", `{
+		"routes": [
+			{"pattern": "/api/", "backend": "missing"}
+		]
+	}`)
+
+	rr := NewRouterReloader(path)
+	if _, err := rr.build(); err == nil {
+		t.Fatal("build: expected error for unknown backend, got nil")
+	}
+}
+
+func TestRouterReloaderBuildUnknownMiddleware(t *testing.T) {
+	path := writeRouteTable(t, t.TempDir(), "routes.json", `{
+		"routes": [
+			{"pattern": "/api/", "static": ".", "middleware": ["auth"]}
+		]
+	}`)
+
+	rr := NewRouterReloader(path)
+	if _, err := rr.build(); err == nil {
+		t.Fatal("build: expected error for unknown middleware, got nil")
+	}
+}
+
+func TestRouterReloaderBuildNoRouteKind(t *testing.T) {
+	path := writeRouteTable(t, t.TempDir(), "routes.json", `{
+		"routes": [
+			{"pattern": "/api/"}
+		]
+	}`)
+
+	rr := NewRouterReloader(path)
+	if _, err := rr.build(); err == nil {
+		t.Fatal("build: expected error for route with no backend/static/proxy/redirect, got nil")
+	}
+}
+
+func TestRouterReloaderReloadHandlerKeepsPreviousHandlerOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := writeRouteTable(t, dir, "routes.json", `{
+		"routes": [{"pattern": "/ok", "static": "."}]
+	}`)
+
+	rr := NewRouterReloader(path)
+	ws := &Server{ReloadErrors: make(chan error, 1)}
+	rr.ReloadHandler(ws)
+	good, _ := ws.handler.Load().(http.Handler)
+	if good == nil {
+		t.Fatal("ReloadHandler: expected a handler to be installed")
+	}
+
+	writeRouteTable(t, dir, "routes.json", `{
+		"routes": [
+			{"pattern": "/ok", "static": "."},
+			{"pattern": "/ok", "static": "."}
+		]
+	}`)
+	rr.ReloadHandler(ws)
+
+	select {
+	case err := <-ws.ReloadErrors:
+		if err == nil {
+			t.Fatal("ReloadErrors: got nil error")
+		}
+	default:
+		t.Fatal("ReloadErrors: expected an error to be sent")
+	}
+
+	if ws.currentHandler() != good {
+		t.Fatal("currentHandler: previous handler should still be installed after a failed reload")
+	}
+}
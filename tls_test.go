@@ -0,0 +1,164 @@
+package watchserverfile
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert generates a throwaway self-signed EC certificate/key
+// pair and writes it to certPath/keyPath as PEM, so certReloader tests
+// exercise real tls.LoadX509KeyPair parsing instead of a hand-rolled fixture.
+func writeSelfSignedCert(t *testing.T, certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"watchserverfile test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	certOut, err := os.Create(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatal(err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	keyOut, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloaderReloadSwapsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	writeSelfSignedCert(t, certPath, keyPath)
+
+	cr, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+
+	first, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if first == nil {
+		t.Fatal("GetCertificate: returned nil certificate")
+	}
+
+	// Re-writing a fresh valid cert/key pair should reload cleanly and
+	// swap in a new *tls.Certificate.
+	writeSelfSignedCert(t, certPath, keyPath)
+	if err := cr.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	second, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate after reload: %v", err)
+	}
+	if second == nil {
+		t.Fatal("GetCertificate after reload: returned nil certificate")
+	}
+	if second == first {
+		t.Error("GetCertificate after reload: expected a distinct *tls.Certificate to have been swapped in")
+	}
+}
+
+func TestCertReloaderReloadKeepsPreviousCertOnError(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	writeSelfSignedCert(t, certPath, keyPath)
+
+	cr, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	before, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+
+	if err := os.WriteFile(certPath, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cr.reload(); err == nil {
+		t.Fatal("reload: expected an error for a corrupt certificate file, got nil")
+	}
+
+	after, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate after failed reload: %v", err)
+	}
+	if after != before {
+		t.Error("GetCertificate after failed reload: expected the previous certificate to still be served")
+	}
+}
+
+func TestWatchCertFilesRotatesOnFileChange(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certPath, keyPath)
+
+	cr, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+
+	ws := &Server{}
+	if err := ws.watchCertFiles(certPath, keyPath, cr); err != nil {
+		t.Fatalf("watchCertFiles: %v", err)
+	}
+
+	rotated := make(chan struct{}, 1)
+	ws.watcherMu.Lock()
+	ws.certCallbacks[certPath] = func() { rotated <- struct{}{} }
+	ws.watcherMu.Unlock()
+
+	writeSelfSignedCert(t, certPath, keyPath)
+
+	select {
+	case <-rotated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a certificate file change to trigger rotation")
+	}
+}
@@ -0,0 +1,145 @@
+package watchserverfile
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+// Debounce is the window used to coalesce a burst of filesystem events
+// (the many Write/Rename/Create events a single editor save can produce)
+// into a single ReloadEvent. It can be changed before calling New,
+// NewMulti or NewGlob.
+var Debounce = 200 * time.Millisecond
+
+// watchedOps is the set of fsnotify operations that can trigger a reload.
+// Besides Write, Rename/Create/Remove are included so editors that save by
+// writing a temp file and renaming it over the original (vim, atomic
+// deploys via `mv`) still trigger a reload.
+const watchedOps = fsnotify.Write | fsnotify.Create | fsnotify.Rename | fsnotify.Remove | fsnotify.Chmod
+
+// ReloadEvent describes the filesystem activity that led to a reload. It is
+// delivered on Server.ReloadFile instead of a bare path so a
+// ReloadHandlerFunc can tell what changed and decide what to rebuild.
+type ReloadEvent struct {
+	Paths []string
+	Ops   []fsnotify.Op
+}
+
+// New watches a single file and returns a Server that reloads whenever it
+// changes. It is equivalent to NewMulti(filename).
+func New(filename string) *Server {
+	return NewMulti(filename)
+}
+
+// NewMulti watches any mix of files and directories. A watched directory
+// is not recursed into; use NewGlob or add subdirectories individually if
+// you need that. Events across all watched paths are debounced by
+// Debounce before a single ReloadEvent is delivered.
+func NewMulti(paths ...string) *Server {
+	ws := new(Server)
+	ws.ReloadFile = make(chan ReloadEvent, 1)
+	ws.ReloadErrors = make(chan error, 1)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal("Watcher: ", err)
+	}
+
+	for _, path := range paths {
+		if err := watcher.Add(path); err != nil {
+			log.Fatal("New WatcherServer: ", err)
+		}
+	}
+
+	ws.watcher = watcher
+	ws.ReloadFile <- ReloadEvent{Paths: paths}
+	go ws.watchFiles(watcher)
+
+	return ws
+}
+
+// NewGlob expands pattern with filepath.Glob and watches every match. The
+// match set is fixed at startup; files created after the fact that would
+// match the pattern are not picked up automatically.
+func NewGlob(pattern string) *Server {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Fatal("New WatcherServer: ", err)
+	}
+	return NewMulti(matches...)
+}
+
+// watchFiles coalesces fsnotify events into debounced ReloadEvents and
+// re-adds paths that were recreated or renamed, so atomic-replace deploys
+// (write new file, rename over the old one) keep being watched.
+func (ws *Server) watchFiles(watcher *fsnotify.Watcher) {
+	pending := make(map[string]fsnotify.Op)
+	certTimers := make(map[string]*time.Timer)
+	var timer *time.Timer
+	var fire <-chan time.Time
+
+	flush := func() {
+		event := ReloadEvent{}
+		for path, op := range pending {
+			event.Paths = append(event.Paths, path)
+			event.Ops = append(event.Ops, op)
+		}
+		pending = make(map[string]fsnotify.Op)
+		log.Println("Reloading for", event.Paths, "...")
+		ws.ReloadFile <- event
+	}
+
+	for {
+		select {
+		case event := <-watcher.Events:
+			if event.Op&watchedOps == 0 {
+				continue
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				// An atomic-replace deploy (write a temp file, then
+				// os.Rename it over the watched path) delivers Remove|Chmod
+				// on the watched path, not Create/Rename: the kernel treats
+				// the rename-over as removing the original inode, and
+				// inotify auto-drops the watch once that happens. Without
+				// re-Add here, every save after the first is silently
+				// dropped. Re-Add only when the path still exists, so a
+				// genuine delete doesn't log a re-add failure forever.
+				if _, statErr := os.Stat(event.Name); statErr == nil {
+					if err := watcher.Add(event.Name); err != nil {
+						log.Println("Watcher re-Add:", err)
+					}
+				}
+			}
+
+			ws.watcherMu.Lock()
+			cb := ws.certCallbacks[event.Name]
+			ws.watcherMu.Unlock()
+			if cb != nil {
+				// Certificate/key files rotate independently of handler
+				// reloads (see tls.go): debounce them on their own timer
+				// and never add them to the handler-reload pending set.
+				if t, ok := certTimers[event.Name]; ok {
+					t.Stop()
+				}
+				certTimers[event.Name] = time.AfterFunc(Debounce, cb)
+				continue
+			}
+
+			pending[event.Name] |= event.Op
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(Debounce)
+			fire = timer.C
+		case <-fire:
+			fire = nil
+			flush()
+		case err := <-watcher.Errors:
+			log.Println("Watcher Error:", err)
+		}
+	}
+}
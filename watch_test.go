@@ -0,0 +1,130 @@
+package watchserverfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitReload blocks until ws delivers a ReloadEvent or the timeout expires,
+// returning the event (or failing the test).
+func waitReload(t *testing.T, ws *Server, timeout time.Duration) ReloadEvent {
+	t.Helper()
+	select {
+	case ev := <-ws.ReloadFile:
+		return ev
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for a ReloadEvent")
+		return ReloadEvent{}
+	}
+}
+
+// drainInitialReload discards the synthetic ReloadEvent NewMulti sends on
+// startup, so tests only observe events triggered by filesystem activity.
+func drainInitialReload(t *testing.T, ws *Server) {
+	t.Helper()
+	waitReload(t, ws, time.Second)
+}
+
+func atomicReplace(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchFilesSurvivesRepeatedAtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("v0"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := NewMulti(path)
+	drainInitialReload(t, ws)
+
+	// The bug this guards against: a single rename-over reloads fine, but
+	// a *second* rename-over the same path silently stops firing once the
+	// kernel has auto-dropped the inotify watch from the first Remove
+	// event, unless watchFiles re-Adds on Remove too.
+	for i := 0; i < 3; i++ {
+		atomicReplace(t, path, "v")
+		ev := waitReload(t, ws, 2*time.Second)
+		found := false
+		for _, p := range ev.Paths {
+			if p == path {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("round %d: ReloadEvent %+v did not include %s", i, ev, path)
+		}
+	}
+}
+
+func TestWatchFilesDebouncesBurstIntoOneReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("v0"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := NewMulti(path)
+	drainInitialReload(t, ws)
+
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(path, []byte("v"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitReload(t, ws, 2*time.Second)
+
+	select {
+	case ev := <-ws.ReloadFile:
+		t.Fatalf("expected the burst of writes to coalesce into one ReloadEvent, got a second one: %+v", ev)
+	case <-time.After(2 * Debounce):
+	}
+}
+
+func TestWatchFilesRoutesCertEventsAwayFromHandlerReload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	certPath := filepath.Join(dir, "cert.pem")
+	for _, p := range []string{configPath, certPath} {
+		if err := os.WriteFile(p, []byte("v0"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws := NewMulti(configPath, certPath)
+	drainInitialReload(t, ws)
+
+	rotated := make(chan struct{}, 1)
+	ws.watcherMu.Lock()
+	ws.certCallbacks = map[string]func(){
+		certPath: func() { rotated <- struct{}{} },
+	}
+	ws.watcherMu.Unlock()
+
+	if err := os.WriteFile(certPath, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-rotated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the cert callback to fire")
+	}
+
+	select {
+	case ev := <-ws.ReloadFile:
+		t.Fatalf("cert file change should not trigger a handler ReloadEvent, got %+v", ev)
+	case <-time.After(3 * Debounce):
+	}
+}